@@ -0,0 +1,607 @@
+package _go
+
+import (
+	"encoding/binary"
+	"fmt"
+	"vm/shm"
+
+	"github.com/cespare/xxhash"
+)
+
+// IndexKind identifies how an IndexSpec turns a record field into a
+// comparable key. It travels through shared memory as a single byte,
+// so it can't be a function pointer.
+type IndexKind byte
+
+const (
+	// IndexXXHash64 hashes the field's raw bytes with xxhash.
+	IndexXXHash64 IndexKind = iota
+	// IndexUint64 reads the field's raw bytes as a little-endian
+	// uint64, for fields that are already a sortable/hashable number
+	// (e.g. a timestamp bucket).
+	IndexUint64
+)
+
+// IndexSpec describes one secondary index over the records stored in
+// an IndexedOracleCache.
+type IndexSpec struct {
+	Name        string
+	FieldOffset uint32
+	FieldWidth  uint32
+	Kind        IndexKind
+	// Capacity bounds how many entries this index can hold. It must be
+	// at least the cache's record capacity: every Put inserts into
+	// every index, so an index sized below the record capacity would
+	// overflow into the next index's shm region once the cache fills.
+	Capacity uint32
+}
+
+const specRecordSize uint32 = 32
+const specNameWidth uint32 = 16
+const indexEntrySize uint32 = 12 // keyHash(8) + recordIdx(4)
+const indexedMetaSize uint32 = 24 // specCount + recordSize + capacity + len + freeHead + pendingFreeHead
+
+// noFreeSlot marks the end of a record free list.
+const noFreeSlot uint32 = 0xFFFFFFFF
+
+// IndexedOracleCache stores fixed-size user records in shared memory
+// alongside several sorted secondary indexes over them, so lookups
+// other than "by primary key" don't require a full scan.
+type IndexedOracleCache struct {
+	mem        *shm.Memory
+	header     *shm.Header
+	specs      []IndexSpec
+	recordSize uint32
+	capacity   uint32
+	recordsOff uint32
+	indexOff   []uint32
+}
+
+// CreateIndexedOracleCache opens name if it already holds a matching
+// schema, or creates it otherwise. specs[0] is treated as the primary
+// index (used by Get); the rest are secondary.
+func CreateIndexedOracleCache(name string, recordSize uint32, capacity uint32, specs []IndexSpec) (*IndexedOracleCache, error) {
+	if recordSize < 4 {
+		return nil, fmt.Errorf("indexedoraclecache: recordSize must be at least 4 bytes, got %d", recordSize)
+	}
+
+	for _, spec := range specs {
+		if spec.Capacity < capacity {
+			return nil, fmt.Errorf("indexedoraclecache: index %q capacity %d is below record capacity %d", spec.Name, spec.Capacity, capacity)
+		}
+	}
+
+	indexOff, recordsOff, totalSize := layoutIndexedCache(recordSize, capacity, specs)
+
+	mem, err := shm.Open(name, int32(totalSize))
+	opened := err == nil
+	if err != nil {
+		mem, err = shm.Create(name, int32(totalSize))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	header := shm.NewHeader(mem, 0)
+	c := &IndexedOracleCache{mem, header, specs, recordSize, capacity, recordsOff, indexOff}
+
+	if opened {
+		if err := c.validateSchema(); err != nil {
+			mem.Close()
+			return nil, err
+		}
+	} else {
+		c.writeSchema()
+	}
+
+	return c, nil
+}
+
+func layoutIndexedCache(recordSize uint32, capacity uint32, specs []IndexSpec) ([]uint32, uint32, uint32) {
+	off := shm.HeaderSize + indexedMetaSize
+	off += uint32(len(specs)) * specRecordSize // serialized specs
+	off += uint32(len(specs)) * 4              // per-index physical entry counts
+	off += uint32(len(specs)) * 4              // per-index tombstone counts
+
+	recordsOff := off
+	off += capacity * (recordSize + 1) // +1 tombstone byte per slot
+
+	indexOff := make([]uint32, len(specs))
+	for i, spec := range specs {
+		indexOff[i] = off
+		off += spec.Capacity * indexEntrySize
+	}
+
+	return indexOff, recordsOff, off
+}
+
+func (c *IndexedOracleCache) metaOff() uint32 { return shm.HeaderSize }
+
+func (c *IndexedOracleCache) specsOff() uint32 { return c.metaOff() + indexedMetaSize }
+
+func (c *IndexedOracleCache) physicalLensOff() uint32 {
+	return c.specsOff() + uint32(len(c.specs))*specRecordSize
+}
+
+func (c *IndexedOracleCache) tombstonesOff() uint32 {
+	return c.physicalLensOff() + uint32(len(c.specs))*4
+}
+
+func serializeSpec(s IndexSpec) []byte {
+	bs := make([]byte, specRecordSize)
+	name := []byte(s.Name)
+	if uint32(len(name)) > specNameWidth {
+		name = name[:specNameWidth]
+	}
+	copy(bs[0:specNameWidth], name)
+	binary.LittleEndian.PutUint32(bs[16:20], s.FieldOffset)
+	binary.LittleEndian.PutUint32(bs[20:24], s.FieldWidth)
+	bs[24] = byte(s.Kind)
+	binary.LittleEndian.PutUint32(bs[28:32], s.Capacity)
+	return bs
+}
+
+// writeSchema persists specCount/recordSize/capacity and the
+// serialized specs so a later CreateIndexedOracleCache call on the
+// same name can validate it is opening the schema it expects.
+func (c *IndexedOracleCache) writeSchema() {
+	bs := make([]byte, 4)
+	binary.LittleEndian.PutUint32(bs, uint32(len(c.specs)))
+	c.mem.WriteAt(bs, int64(c.metaOff()))
+	binary.LittleEndian.PutUint32(bs, c.recordSize)
+	c.mem.WriteAt(bs, int64(c.metaOff()+4))
+	binary.LittleEndian.PutUint32(bs, c.capacity)
+	c.mem.WriteAt(bs, int64(c.metaOff()+8))
+	c.setLen(0)
+	c.setFreeHead(noFreeSlot)
+	c.setPendingFreeHead(noFreeSlot)
+
+	for i, spec := range c.specs {
+		c.mem.WriteAt(serializeSpec(spec), int64(c.specsOff()+uint32(i)*specRecordSize))
+	}
+}
+
+func (c *IndexedOracleCache) validateSchema() error {
+	bs := make([]byte, 4)
+	c.mem.ReadAt(bs, int64(c.metaOff()))
+	if got := binary.LittleEndian.Uint32(bs); got != uint32(len(c.specs)) {
+		return fmt.Errorf("indexedoraclecache: index count mismatch: have %d, want %d", got, len(c.specs))
+	}
+	c.mem.ReadAt(bs, int64(c.metaOff()+4))
+	if got := binary.LittleEndian.Uint32(bs); got != c.recordSize {
+		return fmt.Errorf("indexedoraclecache: record size mismatch: have %d, want %d", got, c.recordSize)
+	}
+	c.mem.ReadAt(bs, int64(c.metaOff()+8))
+	if got := binary.LittleEndian.Uint32(bs); got != c.capacity {
+		return fmt.Errorf("indexedoraclecache: capacity mismatch: have %d, want %d", got, c.capacity)
+	}
+
+	for i, spec := range c.specs {
+		want := serializeSpec(spec)
+		got := make([]byte, specRecordSize)
+		c.mem.ReadAt(got, int64(c.specsOff()+uint32(i)*specRecordSize))
+		for j := range want {
+			if want[j] != got[j] {
+				return fmt.Errorf("indexedoraclecache: schema mismatch on index %q", spec.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *IndexedOracleCache) specIndexByName(name string) int {
+	for i, spec := range c.specs {
+		if spec.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *IndexedOracleCache) Close() error {
+	return c.mem.Close()
+}
+
+func (c *IndexedOracleCache) Len() uint32 {
+	bs := make([]byte, 4)
+	c.mem.ReadAt(bs, int64(c.metaOff()+12))
+	return binary.LittleEndian.Uint32(bs)
+}
+
+func (c *IndexedOracleCache) setLen(n uint32) {
+	bs := make([]byte, 4)
+	binary.LittleEndian.PutUint32(bs, n)
+	c.mem.WriteAt(bs, int64(c.metaOff()+12))
+}
+
+func (c *IndexedOracleCache) freeHead() uint32 {
+	bs := make([]byte, 4)
+	c.mem.ReadAt(bs, int64(c.metaOff()+16))
+	return binary.LittleEndian.Uint32(bs)
+}
+
+func (c *IndexedOracleCache) setFreeHead(idx uint32) {
+	bs := make([]byte, 4)
+	binary.LittleEndian.PutUint32(bs, idx)
+	c.mem.WriteAt(bs, int64(c.metaOff()+16))
+}
+
+func (c *IndexedOracleCache) pendingFreeHead() uint32 {
+	bs := make([]byte, 4)
+	c.mem.ReadAt(bs, int64(c.metaOff()+20))
+	return binary.LittleEndian.Uint32(bs)
+}
+
+func (c *IndexedOracleCache) setPendingFreeHead(idx uint32) {
+	bs := make([]byte, 4)
+	binary.LittleEndian.PutUint32(bs, idx)
+	c.mem.WriteAt(bs, int64(c.metaOff()+20))
+}
+
+// slotNext/setSlotNext reuse a tombstoned record's own storage as the
+// link for whichever free list it is currently on: the record's
+// content is dead once tombstoned, and nothing reads it again until
+// allocSlot hands the slot back out and writeRecord overwrites it.
+func (c *IndexedOracleCache) slotNext(idx uint32) uint32 {
+	bs := make([]byte, 4)
+	c.mem.ReadAt(bs, int64(c.recordSlotOffset(idx)))
+	return binary.LittleEndian.Uint32(bs)
+}
+
+func (c *IndexedOracleCache) setSlotNext(idx uint32, next uint32) {
+	bs := make([]byte, 4)
+	binary.LittleEndian.PutUint32(bs, next)
+	c.mem.WriteAt(bs, int64(c.recordSlotOffset(idx)))
+}
+
+func (c *IndexedOracleCache) physicalLen(i int) uint32 {
+	bs := make([]byte, 4)
+	c.mem.ReadAt(bs, int64(c.physicalLensOff()+uint32(i)*4))
+	return binary.LittleEndian.Uint32(bs)
+}
+
+func (c *IndexedOracleCache) setPhysicalLen(i int, n uint32) {
+	bs := make([]byte, 4)
+	binary.LittleEndian.PutUint32(bs, n)
+	c.mem.WriteAt(bs, int64(c.physicalLensOff()+uint32(i)*4))
+}
+
+func (c *IndexedOracleCache) tombstones(i int) uint32 {
+	bs := make([]byte, 4)
+	c.mem.ReadAt(bs, int64(c.tombstonesOff()+uint32(i)*4))
+	return binary.LittleEndian.Uint32(bs)
+}
+
+func (c *IndexedOracleCache) addTombstones(i int, n int) {
+	bs := make([]byte, 4)
+	binary.LittleEndian.PutUint32(bs, uint32(int(c.tombstones(i))+n))
+	c.mem.WriteAt(bs, int64(c.tombstonesOff()+uint32(i)*4))
+}
+
+func (c *IndexedOracleCache) setTombstones(i int, n uint32) {
+	bs := make([]byte, 4)
+	binary.LittleEndian.PutUint32(bs, n)
+	c.mem.WriteAt(bs, int64(c.tombstonesOff()+uint32(i)*4))
+}
+
+// recordSlotSize is the record width plus one tombstone byte.
+func (c *IndexedOracleCache) recordSlotSize() uint32 { return c.recordSize + 1 }
+
+func (c *IndexedOracleCache) recordSlotOffset(idx uint32) uint32 {
+	return c.recordsOff + idx*c.recordSlotSize()
+}
+
+func (c *IndexedOracleCache) writeRecord(idx uint32, record []byte, tombstoned bool) {
+	off := c.recordSlotOffset(idx)
+	c.mem.WriteAt(record, int64(off))
+	tb := byte(0)
+	if tombstoned {
+		tb = 1
+	}
+	c.mem.WriteAt([]byte{tb}, int64(off+c.recordSize))
+}
+
+func (c *IndexedOracleCache) recordAt(idx uint32) []byte {
+	bs := make([]byte, c.recordSize)
+	c.mem.ReadAt(bs, int64(c.recordSlotOffset(idx)))
+	return bs
+}
+
+func (c *IndexedOracleCache) recordTombstoned(idx uint32) bool {
+	bs := make([]byte, 1)
+	c.mem.ReadAt(bs, int64(c.recordSlotOffset(idx)+c.recordSize))
+	return bs[0] != 0
+}
+
+// markTombstone marks idx dead and pushes it onto the pending-free
+// list rather than the reusable free list directly: other indexes may
+// still hold an entry pointing at idx until their next rebuildIndex,
+// and handing the slot back out before then would let a new Put
+// overwrite data a stale index entry can still resolve to. reclaimPending
+// moves the whole pending list onto the free list once a rebuild has
+// actually purged those entries.
+func (c *IndexedOracleCache) markTombstone(idx uint32) {
+	c.mem.WriteAt([]byte{1}, int64(c.recordSlotOffset(idx)+c.recordSize))
+	c.setSlotNext(idx, c.pendingFreeHead())
+	c.setPendingFreeHead(idx)
+}
+
+// allocSlot returns a record slot to write to, preferring one freed by
+// a prior Delete's rebuild over growing the array.
+func (c *IndexedOracleCache) allocSlot() (uint32, error) {
+	if head := c.freeHead(); head != noFreeSlot {
+		c.setFreeHead(c.slotNext(head))
+		return head, nil
+	}
+
+	idx := c.Len()
+	if idx == c.capacity {
+		return 0, fmt.Errorf("indexedoraclecache: cache full")
+	}
+	c.setLen(idx + 1)
+	return idx, nil
+}
+
+// reclaimPending moves every slot on the pending-free list onto the
+// free list, where allocSlot can hand them back out. Callers must only
+// call this once a rebuildIndex pass has actually run for every index,
+// since that's what guarantees no index entry still points at one of
+// these slots.
+func (c *IndexedOracleCache) reclaimPending() {
+	head := c.pendingFreeHead()
+	if head == noFreeSlot {
+		return
+	}
+
+	tail := head
+	for next := c.slotNext(tail); next != noFreeSlot; next = c.slotNext(tail) {
+		tail = next
+	}
+	c.setSlotNext(tail, c.freeHead())
+	c.setFreeHead(head)
+	c.setPendingFreeHead(noFreeSlot)
+}
+
+func (c *IndexedOracleCache) fieldKey(spec IndexSpec, record []byte) uint64 {
+	field := record[spec.FieldOffset : spec.FieldOffset+spec.FieldWidth]
+	switch spec.Kind {
+	case IndexUint64:
+		return bytesToUint64(field)
+	default:
+		return xxhash.Sum64(field)
+	}
+}
+
+// indexEntryOffset returns the byte offset of the pos-th (keyHash,
+// recordIdx) pair in index i.
+func (c *IndexedOracleCache) indexEntryOffset(i int, pos uint32) uint32 {
+	return c.indexOff[i] + pos*indexEntrySize
+}
+
+func (c *IndexedOracleCache) indexEntryAt(i int, pos uint32) (uint64, uint32) {
+	bs := make([]byte, indexEntrySize)
+	c.mem.ReadAt(bs, int64(c.indexEntryOffset(i, pos)))
+	return bytesToUint64(bs[0:8]), binary.LittleEndian.Uint32(bs[8:12])
+}
+
+func (c *IndexedOracleCache) writeIndexEntry(i int, pos uint32, key uint64, recordIdx uint32) {
+	bs := make([]byte, indexEntrySize)
+	binary.LittleEndian.PutUint64(bs[0:8], key)
+	binary.LittleEndian.PutUint32(bs[8:12], recordIdx)
+	c.mem.WriteAt(bs, int64(c.indexEntryOffset(i, pos)))
+}
+
+// indexLen is the number of entries physically stored in index i's
+// sorted array, live or tombstoned: every indexInsert adds one,
+// rebuildIndex removes the tombstoned ones. Unlike tombstones(i), it
+// is never mutated by anything other than an insert or a rebuild of
+// this same index, so it stays a safe bound for binary search and for
+// rebuildIndex's own scan regardless of what order Delete updates
+// tombstone counts across the other indexes.
+func (c *IndexedOracleCache) indexLen(i int) uint32 {
+	return c.physicalLen(i)
+}
+
+// lowerBound returns the position of the first entry in index i whose
+// key is >= key.
+func (c *IndexedOracleCache) lowerBound(i int, key uint64) uint32 {
+	lo, hi := uint32(0), c.indexLen(i)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		k, _ := c.indexEntryAt(i, mid)
+		if k < key {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// upperBound returns the position just past the last entry in index i
+// whose key is <= key.
+func (c *IndexedOracleCache) upperBound(i int, key uint64) uint32 {
+	lo, hi := uint32(0), c.indexLen(i)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		k, _ := c.indexEntryAt(i, mid)
+		if k <= key {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+func (c *IndexedOracleCache) indexInsert(i int, key uint64, recordIdx uint32) {
+	pos := c.upperBound(i, key)
+	n := c.indexLen(i)
+	for p := n; p > pos; p-- {
+		k, r := c.indexEntryAt(i, p-1)
+		c.writeIndexEntry(i, p, k, r)
+	}
+	c.writeIndexEntry(i, pos, key, recordIdx)
+	c.setPhysicalLen(i, n+1)
+}
+
+const rebuildTombstoneRatio = 0.5
+
+func (c *IndexedOracleCache) shouldRebuild(i int) bool {
+	n := c.indexLen(i)
+	if n == 0 {
+		return false
+	}
+	return float64(c.tombstones(i))/float64(n) >= rebuildTombstoneRatio
+}
+
+// rebuildIndex drops every entry that points at a tombstoned record.
+// Filtering a sorted array preserves order, so this is a straight
+// compaction rather than a re-sort. It scans exactly indexLen(i)
+// entries, the count as of the last insert or rebuild of this index,
+// so it always reaches the physical end of the array even if Delete
+// has already bumped tombstones(i) for a rebuild that hasn't run yet.
+func (c *IndexedOracleCache) rebuildIndex(i int) {
+	n := c.indexLen(i)
+	write := uint32(0)
+	for read := uint32(0); read < n; read++ {
+		key, recordIdx := c.indexEntryAt(i, read)
+		if c.recordTombstoned(recordIdx) {
+			continue
+		}
+		if write != read {
+			c.writeIndexEntry(i, write, key, recordIdx)
+		}
+		write++
+	}
+	c.setPhysicalLen(i, write)
+	c.setTombstones(i, 0)
+}
+
+func (c *IndexedOracleCache) liveRecords(i int, lo, hi uint32) [][]byte {
+	var out [][]byte
+	for pos := lo; pos < hi; pos++ {
+		_, recordIdx := c.indexEntryAt(i, pos)
+		if c.recordTombstoned(recordIdx) {
+			continue
+		}
+		out = append(out, c.recordAt(recordIdx))
+	}
+	return out
+}
+
+// Put stores record, which must be recordSize bytes, and inserts it
+// into every configured index. It reuses a slot freed by a prior
+// Delete's rebuild when one is available, and otherwise grows the
+// record array; it only fails once growth would exceed capacity.
+func (c *IndexedOracleCache) Put(record []byte) (uint32, error) {
+	if uint32(len(record)) != c.recordSize {
+		return 0, fmt.Errorf("indexedoraclecache: record is %d bytes, want %d", len(record), c.recordSize)
+	}
+
+	c.header.BeginWrite()
+	defer c.header.EndWrite()
+
+	idx, err := c.allocSlot()
+	if err != nil {
+		return 0, err
+	}
+
+	c.writeRecord(idx, record, false)
+
+	for i, spec := range c.specs {
+		c.indexInsert(i, c.fieldKey(spec, record), idx)
+	}
+
+	for i := range c.specs {
+		if c.shouldRebuild(i) {
+			c.rebuildIndex(i)
+		}
+	}
+
+	return idx, nil
+}
+
+// Get looks up a record by the primary index (specs[0]). It retries
+// under the cache's seqlock header until it reads a snapshot that
+// wasn't concurrently mutated by Put/Delete, so it never returns a
+// record read mid-rebuild or mid-insert.
+func (c *IndexedOracleCache) Get(key uint64) []byte {
+	var record []byte
+	c.header.ReadConsistent(func() {
+		records := c.liveRecords(0, c.lowerBound(0, key), c.upperBound(0, key))
+		if len(records) > 0 {
+			record = records[0]
+		} else {
+			record = nil
+		}
+	})
+	return record
+}
+
+// GetBySource returns every live record whose "source" index field
+// hashes/equals id, retrying under the seqlock header like Get.
+func (c *IndexedOracleCache) GetBySource(id uint64) [][]byte {
+	i := c.specIndexByName("source")
+	if i < 0 {
+		return nil
+	}
+	var records [][]byte
+	c.header.ReadConsistent(func() {
+		records = c.liveRecords(i, c.lowerBound(i, id), c.upperBound(i, id))
+	})
+	return records
+}
+
+// RangeByTime returns every live record whose "time" index key falls
+// within [lo, hi], retrying under the seqlock header like Get.
+func (c *IndexedOracleCache) RangeByTime(lo, hi uint64) [][]byte {
+	i := c.specIndexByName("time")
+	if i < 0 {
+		return nil
+	}
+	var records [][]byte
+	c.header.ReadConsistent(func() {
+		records = c.liveRecords(i, c.lowerBound(i, lo), c.upperBound(i, hi))
+	})
+	return records
+}
+
+// Delete removes every live record whose specIdx-th index key equals
+// key, and reports how many were removed.
+func (c *IndexedOracleCache) Delete(specIdx int, key uint64) int {
+	c.header.BeginWrite()
+	defer c.header.EndWrite()
+
+	lo, hi := c.lowerBound(specIdx, key), c.upperBound(specIdx, key)
+	removed := 0
+	for pos := lo; pos < hi; pos++ {
+		_, recordIdx := c.indexEntryAt(specIdx, pos)
+		if c.recordTombstoned(recordIdx) {
+			continue
+		}
+		c.markTombstone(recordIdx)
+		removed++
+	}
+
+	if removed > 0 {
+		rebuilt := false
+		for i := range c.specs {
+			c.addTombstones(i, removed)
+			if c.shouldRebuild(i) {
+				c.rebuildIndex(i)
+				rebuilt = true
+			}
+		}
+		// Every spec's tombstone ratio is driven by the same Put/Delete
+		// calls, so they cross rebuildTombstoneRatio together; once any
+		// of them rebuilds this call, all of them just did, which is
+		// what makes it safe to hand the tombstoned slots back out.
+		if rebuilt {
+			c.reclaimPending()
+		}
+	}
+
+	return removed
+}
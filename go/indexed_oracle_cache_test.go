@@ -0,0 +1,135 @@
+package _go
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func testIndexedRecord(ticker, source, ts, price uint64) []byte {
+	bs := make([]byte, 32)
+	binary.LittleEndian.PutUint64(bs[0:8], ticker)
+	binary.LittleEndian.PutUint64(bs[8:16], source)
+	binary.LittleEndian.PutUint64(bs[16:24], ts)
+	binary.LittleEndian.PutUint64(bs[24:32], price)
+	return bs
+}
+
+func testIndexedSpecs() []IndexSpec {
+	return []IndexSpec{
+		{Name: "ticker", FieldOffset: 0, FieldWidth: 8, Kind: IndexUint64, Capacity: 100},
+		{Name: "source", FieldOffset: 8, FieldWidth: 8, Kind: IndexUint64, Capacity: 100},
+		{Name: "time", FieldOffset: 16, FieldWidth: 8, Kind: IndexUint64, Capacity: 100},
+	}
+}
+
+func TestIndexedOracleCacheGetBySourceAndTime(t *testing.T) {
+	cache, err := CreateIndexedOracleCache("/indexed_test", 32, 100, testIndexedSpecs())
+	if err != nil {
+		t.Fatalf("Failed to create indexed cache: %v", err)
+	}
+	defer cache.Close()
+
+	cache.Put(testIndexedRecord(1, 10, 100, 8000))
+	cache.Put(testIndexedRecord(2, 10, 200, 70))
+	cache.Put(testIndexedRecord(3, 20, 300, 1))
+
+	if got := cache.Get(2); got == nil || binary.LittleEndian.Uint64(got[24:32]) != 70 {
+		t.Errorf("Get(2) returned wrong record: %v", got)
+	}
+
+	bySource := cache.GetBySource(10)
+	if len(bySource) != 2 {
+		t.Errorf("Expected 2 records for source 10, got %d", len(bySource))
+	}
+
+	byTime := cache.RangeByTime(150, 300)
+	if len(byTime) != 2 {
+		t.Errorf("Expected 2 records in time range, got %d", len(byTime))
+	}
+}
+
+func TestIndexedOracleCacheDeleteCompacts(t *testing.T) {
+	cache, err := CreateIndexedOracleCache("/indexed_test_2", 32, 4, testIndexedSpecs())
+	if err != nil {
+		t.Fatalf("Failed to create indexed cache: %v", err)
+	}
+	defer cache.Close()
+
+	cache.Put(testIndexedRecord(1, 10, 100, 8000))
+	cache.Put(testIndexedRecord(2, 10, 200, 70))
+	cache.Put(testIndexedRecord(3, 30, 300, 2))
+	cache.Put(testIndexedRecord(4, 40, 400, 3))
+
+	if removed := cache.Delete(0, 1); removed != 1 {
+		t.Errorf("Expected to delete 1 record, removed %d", removed)
+	}
+
+	// The second delete pushes the tombstone ratio to the 0.5 threshold,
+	// triggering rebuildIndex on every index in the same call. Records 3
+	// and 4 were never deleted, so they must still be there afterwards:
+	// a rebuild whose scan bound stops short of the physical array
+	// silently drops trailing live entries instead of just compacting
+	// out the tombstoned ones.
+	if removed := cache.Delete(0, 2); removed != 1 {
+		t.Errorf("Expected to delete 1 record, removed %d", removed)
+	}
+
+	if cache.Get(1) != nil {
+		t.Errorf("Deleted record still returned by Get")
+	}
+	if cache.Get(2) != nil {
+		t.Errorf("Deleted record still returned by Get")
+	}
+
+	if got := cache.GetBySource(10); len(got) != 0 {
+		t.Errorf("Expected 0 live records for source 10 after both deletes, got %d", len(got))
+	}
+	if got := cache.GetBySource(30); len(got) != 1 {
+		t.Errorf("Expected surviving record for source 30 after compaction, got %d", len(got))
+	}
+	if got := cache.GetBySource(40); len(got) != 1 {
+		t.Errorf("Expected surviving record for source 40 after compaction, got %d", len(got))
+	}
+
+	if got := cache.RangeByTime(250, 450); len(got) != 2 {
+		t.Errorf("Expected 2 surviving records in time range after compaction, got %d", len(got))
+	}
+}
+
+// TestIndexedOracleCachePutReclaimsDeletedSlots covers the record slot
+// side of compaction: once a Delete's rebuild has purged every index
+// entry pointing at a tombstoned record, that slot must be handed back
+// out by Put instead of the cache staying permanently smaller once it
+// has churned through its capacity once.
+func TestIndexedOracleCachePutReclaimsDeletedSlots(t *testing.T) {
+	cache, err := CreateIndexedOracleCache("/indexed_test_3", 32, 2, testIndexedSpecs())
+	if err != nil {
+		t.Fatalf("Failed to create indexed cache: %v", err)
+	}
+	defer cache.Close()
+
+	if _, err := cache.Put(testIndexedRecord(1, 10, 100, 8000)); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := cache.Put(testIndexedRecord(2, 10, 200, 70)); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	if _, err := cache.Put(testIndexedRecord(3, 10, 300, 1)); err == nil {
+		t.Fatalf("Expected Put to fail once capacity is exhausted")
+	}
+
+	if removed := cache.Delete(0, 1); removed != 1 {
+		t.Fatalf("Expected to delete 1 record, removed %d", removed)
+	}
+	if removed := cache.Delete(0, 2); removed != 1 {
+		t.Fatalf("Expected to delete 1 record, removed %d", removed)
+	}
+
+	if _, err := cache.Put(testIndexedRecord(3, 10, 300, 1)); err != nil {
+		t.Errorf("Put should have reclaimed a slot freed by the deletes, got: %v", err)
+	}
+	if got := cache.Get(3); got == nil {
+		t.Errorf("Reused-slot record not found by Get")
+	}
+}
@@ -5,41 +5,117 @@ import (
 	"fmt"
 	"github.com/cespare/xxhash"
 	"strings"
+	"time"
+	"vm/persist"
 	"vm/shm"
 )
 
+const HeaderSize = shm.HeaderSize
+const EvictionHeaderSize uint32 = 8
+const PersistHeaderSize uint32 = 4
 const LenSize uint32 = 4
-const ItemSize uint32 = 16
+const ItemSize uint32 = 17
 const TickerSize uint32 = 8
+const StateSize uint32 = 1
+
+// Policy selects what OracleCache.PutPrice does once the cache is full.
+type Policy int
+
+const (
+	// Adaptive evicts a CLOCK-Pro-chosen entry instead of rejecting the
+	// write, so the cache behaves like a rolling price feed. This is
+	// the default used by CreateOracleCache.
+	Adaptive Policy = iota
+	// StrictBounded keeps the original behavior: PutPrice returns
+	// false once Len() reaches capacity.
+	StrictBounded
+)
 
 type OracleCache struct {
-	mem      *shm.Memory
-	capacity uint32
+	mem         *shm.Memory
+	header      *shm.Header
+	capacity    uint32
+	policy      Policy
+	persistence persist.Persistence
+	flushStop   chan struct{}
+	flushDone   chan struct{}
+}
+
+func totalSize(capacity uint32) uint32 {
+	return HeaderSize + EvictionHeaderSize + PersistHeaderSize + LenSize + capacity*ItemSize
 }
 
+// CreateOracleCache opens or creates name with Adaptive eviction, i.e.
+// PutPrice never rejects a write once the cache is full. Use
+// NewOracleCache to opt into the original StrictBounded behavior.
 func CreateOracleCache(name string, capacity uint32) (*OracleCache, error) {
-	bufferSize := int32(LenSize + (capacity * ItemSize))
+	return NewOracleCache(name, capacity, Adaptive)
+}
+
+// NewOracleCache opens or creates name with the given overflow Policy.
+func NewOracleCache(name string, capacity uint32, policy Policy) (*OracleCache, error) {
+	o, _, err := newOracleCache(name, capacity, policy)
+	return o, err
+}
+
+// NewPersistentOracleCache behaves like NewOracleCache, except that a
+// freshly-created shm segment is pre-populated from p's last saved
+// snapshot (so the cache survives every process that had it open
+// dying), and a background goroutine calls ForceSnapshot every
+// flushInterval while the cache is dirty, plus once more on Close.
+func NewPersistentOracleCache(name string, capacity uint32, policy Policy, p persist.Persistence, flushInterval time.Duration) (*OracleCache, error) {
+	o, created, err := newOracleCache(name, capacity, policy)
+	if err != nil {
+		return nil, err
+	}
+	o.persistence = p
+
+	if created {
+		if err := o.LoadSnapshot(); err != nil {
+			return nil, err
+		}
+	}
+
+	o.flushStop = make(chan struct{})
+	o.flushDone = make(chan struct{})
+	go o.flushLoop(flushInterval)
+
+	return o, nil
+}
+
+func newOracleCache(name string, capacity uint32, policy Policy) (*OracleCache, bool, error) {
+	bufferSize := int32(totalSize(capacity))
 	mem, err := shm.Open(name, bufferSize)
+	created := false
 	if err != nil {
 		mem, err = shm.Create(name, bufferSize)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
+		created = true
 	}
 
-	return &OracleCache{mem, capacity}, nil
+	header := shm.NewHeader(mem, 0)
+	return &OracleCache{mem: mem, header: header, capacity: capacity, policy: policy}, created, nil
 }
 
 func (o OracleCache) Clear() {
 	o.setSize(0)
+	o.setHand(0)
+	o.setDirty(true)
 }
 
 func (o OracleCache) PutPrice(ticker string, price uint64) bool {
+	if o.policy == Adaptive {
+		return o.PutPriceEvict(ticker, price)
+	}
+
 	hash := xxTicker(ticker)
 	priceBytes := uint64ToBytes(price)
 	first, last := o.findIndex(hash)
 	if first == last {
 		o.storeAtIndex(first, uint64ToBytes(hash), priceBytes)
+		o.setDirty(true)
 		return true
 	} else {
 		if o.Len() == o.capacity {
@@ -48,6 +124,7 @@ func (o OracleCache) PutPrice(ticker string, price uint64) bool {
 			o.setSize(o.Len() + 1)
 			o.shiftRight(first)
 			o.storeAtIndex(first, uint64ToBytes(hash), priceBytes)
+			o.setDirty(true)
 			return true
 		}
 	}
@@ -57,23 +134,129 @@ func (o OracleCache) GetPrice(ticker string) *uint64 {
 	hash := xxTicker(ticker)
 	first, last := o.findIndex(hash)
 	if first == last {
-		price := bytesToUint64(o.getByIndex(first)[TickerSize:])
+		price := bytesToUint64(o.getByIndex(first)[TickerSize : TickerSize+8])
+		o.setRef(first, true)
 		return &price
 	} else {
 		return nil
 	}
 }
 
+// PutPriceAtomic behaves like PutPrice but wraps the mutation in the
+// cache's seqlock header so GetPriceConsistent readers never observe a
+// torn shift or store, even while this call is still shifting entries.
+func (o OracleCache) PutPriceAtomic(ticker string, price uint64) bool {
+	o.header.BeginWrite()
+	defer o.header.EndWrite()
+	return o.PutPrice(ticker, price)
+}
+
+// GetPriceConsistent behaves like GetPrice but retries under the
+// cache's seqlock header until it reads a snapshot that wasn't
+// concurrently mutated by a PutPriceAtomic writer, instead of risking a
+// torn ticker/price pair or a slot that shifted mid-read.
+func (o OracleCache) GetPriceConsistent(ticker string) *uint64 {
+	var price *uint64
+	o.header.ReadConsistent(func() {
+		price = o.GetPrice(ticker)
+	})
+	return price
+}
+
 func (o OracleCache) Len() uint32 {
 	bs := make([]byte, 4)
-	o.mem.ReadAt(bs, 0)
+	o.mem.ReadAt(bs, int64(HeaderSize+EvictionHeaderSize+PersistHeaderSize))
 	return binary.LittleEndian.Uint32(bs)
 }
 
+// Close stops the persistence flush loop (flushing once more if dirty)
+// when this cache was opened via NewPersistentOracleCache, then closes
+// the underlying shm segment.
 func (o OracleCache) Close() (err error) {
+	if o.flushStop != nil {
+		close(o.flushStop)
+		<-o.flushDone
+	}
 	return o.mem.Close()
 }
 
+func (o OracleCache) dirty() bool {
+	bs := make([]byte, 4)
+	o.mem.ReadAt(bs, int64(HeaderSize+EvictionHeaderSize))
+	return binary.LittleEndian.Uint32(bs) != 0
+}
+
+func (o OracleCache) setDirty(d bool) {
+	v := uint32(0)
+	if d {
+		v = 1
+	}
+	bs := make([]byte, 4)
+	binary.LittleEndian.PutUint32(bs, v)
+	o.mem.WriteAt(bs, int64(HeaderSize+EvictionHeaderSize))
+}
+
+// ForceSnapshot saves the cache's current shm payload through its
+// Persistence backend, regardless of the dirty bit, and clears the bit
+// on success. It is a no-op if the cache wasn't opened with
+// NewPersistentOracleCache. Exposed directly for ops tooling and tests
+// that don't want to wait for the flush interval.
+func (o OracleCache) ForceSnapshot() error {
+	if o.persistence == nil {
+		return nil
+	}
+	bs := make([]byte, o.totalSize())
+	o.mem.ReadAt(bs, 0)
+	if err := o.persistence.Save(bs); err != nil {
+		return err
+	}
+	o.setDirty(false)
+	return nil
+}
+
+// LoadSnapshot restores the cache's shm payload from the last snapshot
+// saved through its Persistence backend, if one exists. It is a no-op
+// if the cache wasn't opened with NewPersistentOracleCache.
+func (o OracleCache) LoadSnapshot() error {
+	if o.persistence == nil {
+		return nil
+	}
+	bs, err := o.persistence.Load()
+	if err != nil {
+		return err
+	}
+	if bs == nil {
+		return nil
+	}
+	o.mem.WriteAt(bs, 0)
+	o.setDirty(false)
+	return nil
+}
+
+func (o OracleCache) totalSize() uint32 {
+	return totalSize(o.capacity)
+}
+
+func (o OracleCache) flushLoop(interval time.Duration) {
+	defer close(o.flushDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if o.dirty() {
+				o.ForceSnapshot()
+			}
+		case <-o.flushStop:
+			if o.dirty() {
+				o.ForceSnapshot()
+			}
+			return
+		}
+	}
+}
+
 func (o OracleCache) ToString() string {
 	buff := "["
 	l := o.Len()
@@ -116,7 +299,7 @@ func (o OracleCache) findIndex(ticker uint64) (uint32, uint32) {
 }
 
 func offset(index uint32) uint32 {
-	return ItemSize*index + LenSize
+	return ItemSize*index + HeaderSize + EvictionHeaderSize + PersistHeaderSize + LenSize
 }
 
 func (o OracleCache) storeAtIndex(index uint32, ticker []byte, price []byte) {
@@ -126,22 +309,26 @@ func (o OracleCache) storeAtIndex(index uint32, ticker []byte, price []byte) {
 }
 
 func (o OracleCache) getByIndex(index uint32) []byte {
-	offset := offset(index)
-	return o.mem.Slice(int64(offset), int64(ItemSize+offset))
+	return o.mem.Slice(int64(offset(index)), int64(ItemSize))
 }
 
 func (o OracleCache) setSize(size uint32) {
 	bs := make([]byte, 4)
 	binary.LittleEndian.PutUint32(bs, size)
-	o.mem.WriteAt(bs, 0)
+	o.mem.WriteAt(bs, int64(HeaderSize+EvictionHeaderSize+PersistHeaderSize))
 }
 
+// shiftRight makes room for a new entry at index by moving every item
+// in [index, Len()-1) up by one slot. It goes through Memory.Slice
+// instead of a ReadAt/WriteAt round trip through a scratch buffer, so
+// an insert doesn't allocate proportional to how much of the array it
+// has to move; copy handles the overlap between src and dst itself.
 func (o OracleCache) shiftRight(index uint32) {
 	startOffset := offset(index)
 	endOffset := offset(o.Len() - 1)
-	bs := make([]byte, endOffset-startOffset)
-	o.mem.ReadAt(bs, int64(startOffset))
-	o.mem.WriteAt(bs, int64(offset(index+1)))
+	src := o.mem.Slice(int64(startOffset), int64(endOffset-startOffset))
+	dst := o.mem.Slice(int64(offset(index+1)), int64(endOffset-startOffset))
+	copy(dst, src)
 }
 
 func xxTicker(ticker string) uint64 {
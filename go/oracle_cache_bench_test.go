@@ -0,0 +1,69 @@
+package _go
+
+import (
+	"fmt"
+	"testing"
+)
+
+// BenchmarkOracleCacheGetPrice exercises the binary search read path
+// (findIndex -> getByIndex), which goes through the zero-copy
+// Memory.Slice instead of allocating a fresh []byte per probe.
+func BenchmarkOracleCacheGetPrice(b *testing.B) {
+	cache, err := NewOracleCache("/bench_get", 1000, StrictBounded)
+	if err != nil {
+		b.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+	cache.Clear()
+
+	for i := 0; i < 1000; i++ {
+		cache.PutPrice(fmt.Sprintf("T:%d", i), uint64(i))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.GetPrice(fmt.Sprintf("T:%d", i%1000))
+	}
+}
+
+// BenchmarkOracleCachePutPrice exercises the update-in-place path
+// (same ticker every time, so no shift), which also reads via
+// findIndex/getByIndex before writing.
+func BenchmarkOracleCachePutPrice(b *testing.B) {
+	cache, err := NewOracleCache("/bench_put", 1000, StrictBounded)
+	if err != nil {
+		b.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+	cache.Clear()
+	cache.PutPrice("BTCUSD", 0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.PutPrice("BTCUSD", uint64(i))
+	}
+}
+
+// BenchmarkOracleCachePutPriceInsert exercises the insert path (a new
+// ticker every time, so findIndex misses and PutPrice has to
+// shiftRight), which BenchmarkOracleCachePutPrice's same-ticker update
+// never touches.
+func BenchmarkOracleCachePutPriceInsert(b *testing.B) {
+	cache, err := NewOracleCache("/bench_put_insert", 10000, StrictBounded)
+	if err != nil {
+		b.Fatalf("Failed to create cache: %v", err)
+	}
+	defer cache.Close()
+	cache.Clear()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.PutPrice(fmt.Sprintf("T:%d", i%10000), uint64(i))
+		if i%10000 == 9999 {
+			cache.Clear()
+		}
+	}
+}
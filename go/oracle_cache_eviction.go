@@ -0,0 +1,150 @@
+package _go
+
+import "encoding/binary"
+
+// Per-slot state, stored in the byte immediately after each item's
+// price. cold/hot mirror the CLOCK half of CLOCK-Pro; the reference
+// bit (set on every GetPrice hit) is kept separately from the state so
+// a clock sweep can clear it without losing the state.
+const (
+	stateCold byte = 0
+	stateHot  byte = 1
+)
+
+const stateMask byte = 0x03
+const refBit byte = 0x04
+
+// PutPriceEvict behaves like PutPrice, but once the cache is full it
+// runs a CLOCK sweep to reclaim a slot instead of rejecting the write:
+// the hand advances over entries, promoting referenced cold slots to
+// hot and evicting the first unreferenced cold slot it finds, and hot
+// slots are demoted to cold as the hand passes them.
+func (o OracleCache) PutPriceEvict(ticker string, price uint64) bool {
+	hash := xxTicker(ticker)
+	priceBytes := uint64ToBytes(price)
+	first, last := o.findIndex(hash)
+	if first == last {
+		o.storeAtIndex(first, uint64ToBytes(hash), priceBytes)
+		o.setRef(first, true)
+		o.setDirty(true)
+		return true
+	}
+
+	if o.Len() == o.capacity {
+		if !o.evictOne() {
+			return false
+		}
+		first, _ = o.findIndex(hash)
+	}
+
+	o.setSize(o.Len() + 1)
+	o.shiftRight(first)
+	o.storeAtIndex(first, uint64ToBytes(hash), priceBytes)
+	o.setDirty(true)
+	o.setState(first, stateCold)
+	o.setRef(first, false)
+	return true
+}
+
+// evictOne sweeps at most three full passes of the hand over the
+// array, demoting hot to cold and promoting cold-referenced to hot as it goes,
+// and evicting the first unreferenced cold slot it finds. Three passes
+// is the worst case: a cold+referenced slot needs one pass to become
+// hot, another to fall back to cold, and a third to be evicted
+// unreferenced. It reports whether a slot was freed.
+func (o OracleCache) evictOne() bool {
+	len := o.Len()
+	if len == 0 {
+		return false
+	}
+
+	hand := o.hand() % len
+	for i := uint32(0); i < len*3; i++ {
+		idx := (hand + i) % len
+		state, ref := o.stateAt(idx)
+
+		switch state {
+		case stateCold:
+			if !ref {
+				o.deleteAt(idx)
+				if newLen := o.Len(); newLen > 0 {
+					o.setHand(idx % newLen)
+				} else {
+					o.setHand(0)
+				}
+				return true
+			}
+			o.setState(idx, stateHot)
+			o.setRef(idx, false)
+		case stateHot:
+			o.setState(idx, stateCold)
+			o.setRef(idx, false)
+		}
+	}
+
+	return false
+}
+
+func (o OracleCache) deleteAt(index uint32) {
+	o.shiftLeft(index)
+	o.setSize(o.Len() - 1)
+}
+
+// shiftLeft closes the gap left by evicting index, moving every item
+// in [index+1, Len()) down by one slot. Like shiftRight, it goes
+// through Memory.Slice so an eviction doesn't allocate proportional to
+// how much of the array it has to move.
+func (o OracleCache) shiftLeft(index uint32) {
+	len := o.Len()
+	if index+1 >= len {
+		return
+	}
+	startOffset := offset(index + 1)
+	endOffset := offset(len)
+	src := o.mem.Slice(int64(startOffset), int64(endOffset-startOffset))
+	dst := o.mem.Slice(int64(offset(index)), int64(endOffset-startOffset))
+	copy(dst, src)
+}
+
+func stateOffset(index uint32) uint32 {
+	return offset(index) + TickerSize + 8
+}
+
+func (o OracleCache) stateAt(index uint32) (byte, bool) {
+	bs := make([]byte, 1)
+	o.mem.ReadAt(bs, int64(stateOffset(index)))
+	return bs[0] & stateMask, bs[0]&refBit != 0
+}
+
+func (o OracleCache) setState(index uint32, state byte) {
+	_, ref := o.stateAt(index)
+	o.writeState(index, state, ref)
+}
+
+func (o OracleCache) setRef(index uint32, ref bool) {
+	state, _ := o.stateAt(index)
+	o.writeState(index, state, ref)
+}
+
+func (o OracleCache) writeState(index uint32, state byte, ref bool) {
+	b := state & stateMask
+	if ref {
+		b |= refBit
+	}
+	o.mem.WriteAt([]byte{b}, int64(stateOffset(index)))
+}
+
+// hand occupies the first word of the eviction header; the second
+// word (HeaderSize+4) is reserved padding, kept so EvictionHeaderSize
+// stays 8-byte aligned.
+func (o OracleCache) hand() uint32 {
+	bs := make([]byte, 4)
+	o.mem.ReadAt(bs, int64(HeaderSize))
+	return binary.LittleEndian.Uint32(bs)
+}
+
+func (o OracleCache) setHand(h uint32) {
+	bs := make([]byte, 4)
+	binary.LittleEndian.PutUint32(bs, h)
+	o.mem.WriteAt(bs, int64(HeaderSize))
+}
@@ -0,0 +1,47 @@
+// Package leveldb is a persist.Persistence backed by a LevelDB
+// database, so an OracleCache's shm payload survives across restarts.
+package leveldb
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Store persists snapshots for one or more caches in a single LevelDB
+// database, keyed by cache name so they don't collide.
+type Store struct {
+	db   *leveldb.DB
+	name string
+}
+
+// Open opens (creating if necessary) the LevelDB database at path and
+// returns a Store that saves/loads snapshots for the cache called
+// name.
+func Open(path string, name string) (*Store, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db, name}, nil
+}
+
+// Save implements persist.Persistence.
+func (s *Store) Save(snapshot []byte) error {
+	return s.db.Put([]byte(s.name), snapshot, nil)
+}
+
+// Load implements persist.Persistence.
+func (s *Store) Load() ([]byte, error) {
+	v, err := s.db.Get([]byte(s.name), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Close closes the underlying LevelDB database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,15 @@
+// Package persist declares the pluggable storage backend OracleCache
+// uses to survive every process that touches its shared-memory segment
+// dying at once.
+package persist
+
+// Persistence saves and restores the raw bytes of a cache's shm
+// payload (header + items) under some backend-chosen key, typically
+// the cache's name.
+type Persistence interface {
+	// Save persists snapshot, overwriting whatever was saved before.
+	Save(snapshot []byte) error
+	// Load returns the last snapshot saved, or (nil, nil) if none
+	// exists yet.
+	Load() ([]byte, error)
+}
@@ -0,0 +1,43 @@
+package shm
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	futexWaitOp = 0 // FUTEX_WAIT
+	futexWakeOp = 1 // FUTEX_WAKE
+)
+
+// futexWait blocks the calling thread until addr no longer holds
+// expected, another thread calls futexWake on it, or it is interrupted
+// by a signal. The low 32 bits of *addr are used, matching Linux's
+// 32-bit futex word.
+func futexWait(addr *uint64, expected uint64) {
+	word := (*uint32)(unsafe.Pointer(addr))
+	_, _, _ = syscall.Syscall6(
+		syscall.SYS_FUTEX,
+		uintptr(unsafe.Pointer(word)),
+		futexWaitOp,
+		uintptr(uint32(expected)),
+		0, 0, 0,
+	)
+}
+
+// futexWake wakes every thread blocked in futexWait on addr.
+func futexWake(addr *uint64) {
+	word := (*uint32)(unsafe.Pointer(addr))
+	_, _, _ = syscall.Syscall6(
+		syscall.SYS_FUTEX,
+		uintptr(unsafe.Pointer(word)),
+		futexWakeOp,
+		^uintptr(0),
+		0, 0, 0,
+	)
+}
+
+// syscallKill reports, via signal 0, whether pid still exists.
+func syscallKill(pid int) error {
+	return syscall.Kill(pid, 0)
+}
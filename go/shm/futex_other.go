@@ -0,0 +1,22 @@
+// +build !linux
+
+package shm
+
+import "runtime"
+
+// futexWait has no portable equivalent outside Linux, so non-Linux
+// backends fall back to yielding the scheduler; Header.ReadConsistent
+// still bounds how often this runs via spinLimit before calling it.
+func futexWait(addr *uint64, expected uint64) {
+	runtime.Gosched()
+}
+
+// futexWake is a no-op where futexWait never actually parks.
+func futexWake(addr *uint64) {}
+
+// syscallKill reports a writer pid as alive everywhere outside Linux,
+// since there is no single portable "does this pid exist" check; the
+// seqlock still makes progress once that writer calls EndWrite.
+func syscallKill(pid int) error {
+	return nil
+}
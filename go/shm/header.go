@@ -0,0 +1,142 @@
+package shm
+
+import (
+	"os"
+	"sync/atomic"
+	"unsafe"
+)
+
+// HeaderSize is the number of bytes reserved for a Header at the start
+// of the region it protects: an 8-byte sequence counter followed by a
+// 4-byte writer-pid field (4 bytes of padding keep the counter 8-byte
+// aligned).
+const HeaderSize uint32 = 16
+
+// spinLimit is how many times a reader retries before falling back to
+// futexWait instead of busy-spinning.
+const spinLimit = 200
+
+// Header is a seqlock stored at a fixed offset inside a Memory mapping.
+// It lets one writer at a time mutate the bytes that follow the header
+// while concurrent readers in other processes keep retrying until they
+// observe a stable, even sequence number, instead of reading torn data.
+//
+// The layout mirrors the Linux seqlock convention: the sequence counter
+// is odd while a writer is in progress and even once a write has been
+// committed. The writer-pid field lets a reader notice that the writer
+// which bumped the counter to odd has since died, so it doesn't spin
+// forever waiting for a commit that will never come.
+type Header struct {
+	mem *Memory
+	off int64
+}
+
+// NewHeader wraps the HeaderSize bytes of mem starting at off as a
+// seqlock header. Callers lay out their own data immediately after
+// off+int64(HeaderSize).
+func NewHeader(mem *Memory, off int64) *Header {
+	return &Header{mem: mem, off: off}
+}
+
+func (h *Header) seqAddr() *uint64 {
+	return (*uint64)(unsafe.Pointer(h.mem.m.ptrAt(h.off)))
+}
+
+func (h *Header) pidAddr() *uint32 {
+	return (*uint32)(unsafe.Pointer(h.mem.m.ptrAt(h.off + 8)))
+}
+
+// Seq returns the current value of the sequence counter.
+func (h *Header) Seq() uint64 {
+	return atomic.LoadUint64(h.seqAddr())
+}
+
+// WriterPid returns the pid most recently recorded by BeginWrite, or 0
+// if no writer has ever started a mutation.
+func (h *Header) WriterPid() uint32 {
+	return atomic.LoadUint32(h.pidAddr())
+}
+
+// BeginWrite claims the header for writing and marks it "write in
+// progress": it CASes the sequence counter from even to odd, retrying
+// (via futexWait once another writer is already mid-write) until it
+// wins that CAS, then records the calling process's pid. The CAS is
+// what gives BeginWrite/EndWrite real mutual exclusion between
+// concurrent writers, not just the reader-visible odd/even convention.
+// It must be paired with EndWrite, typically via defer.
+//
+// If the writer currently holding the lock has died (seq stuck odd,
+// its pid gone), BeginWrite steals the lock instead of waiting on a
+// commit that will never come: it CASes seq forward by two, to the
+// next odd value, and takes over as the writer of record.
+func (h *Header) BeginWrite() {
+	seqAddr := h.seqAddr()
+	for {
+		seq := atomic.LoadUint64(seqAddr)
+		if seq&1 != 0 {
+			if isDead(atomic.LoadUint32(h.pidAddr())) {
+				if atomic.CompareAndSwapUint64(seqAddr, seq, seq+2) {
+					atomic.StoreUint32(h.pidAddr(), uint32(os.Getpid()))
+					return
+				}
+				continue
+			}
+			futexWait(seqAddr, seq)
+			continue
+		}
+		if atomic.CompareAndSwapUint64(seqAddr, seq, seq+1) {
+			atomic.StoreUint32(h.pidAddr(), uint32(os.Getpid()))
+			return
+		}
+	}
+}
+
+// EndWrite commits the mutation by bumping the sequence counter to an
+// even value and waking any readers blocked in futexWait.
+func (h *Header) EndWrite() {
+	atomic.AddUint64(h.seqAddr(), 1)
+	futexWake(h.seqAddr())
+}
+
+// isDead reports whether the pid that owns an in-progress write no
+// longer exists, the FUTEX_OWNER_DIED-style recovery signal mentioned
+// in the design: a crashed writer leaves the counter odd forever, but
+// its pid is gone, so readers can stop waiting for a commit.
+func isDead(pid uint32) bool {
+	if pid == 0 {
+		return false
+	}
+	err := syscallKill(int(pid))
+	return err != nil
+}
+
+// ReadConsistent runs read until it completes against a stable, even
+// sequence number, retrying on a torn or concurrently-mutated read. It
+// spins for a bounded number of attempts before parking in futexWait,
+// and stops waiting for a commit that will never come if the writer
+// that started the in-progress write has died: BeginWrite is what
+// actually steals the lock back from a dead writer, so a reader that
+// hits this just runs read() once against whatever is there rather
+// than spinning forever.
+func (h *Header) ReadConsistent(read func()) {
+	for attempt := 0; ; attempt++ {
+		before := h.Seq()
+		if before&1 == 1 {
+			if isDead(h.WriterPid()) {
+				read()
+				return
+			}
+			if attempt >= spinLimit {
+				futexWait(h.seqAddr(), before)
+			}
+			continue
+		}
+
+		read()
+
+		after := h.Seq()
+		if before == after {
+			return
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// +build linux,cgo
+
+package shm
+
+import "testing"
+
+func TestSliceRefPinsMappingAcrossClose(t *testing.T) {
+	mem, err := Create("ref_test", 64)
+	if err != nil {
+		t.Fatalf("Failed to create shm: %v", err)
+	}
+
+	mem.WriteAt([]byte("hello"), 0)
+
+	ref := mem.SliceRef(0, 5)
+	if err := mem.Close(); err != nil {
+		t.Fatalf("Close with outstanding ref failed: %v", err)
+	}
+
+	if string(ref.Bytes()) != "hello" {
+		t.Errorf("Ref data changed before Release, got %q", ref.Bytes())
+	}
+
+	ref.Release()
+}
+
+// TestSliceRefCloseRaceDoesNotLeak drives Close and release from
+// separate goroutines many times over, which TestSliceRefPinsMappingAcrossClose
+// (a single sequential Close-then-Release) can't: Close's "any refs
+// outstanding?" check and release's "did refs hit zero?" check must be
+// one atomic update, or a release that wins the race sees no pending
+// close request and the mapping is never unmapped.
+func TestSliceRefCloseRaceDoesNotLeak(t *testing.T) {
+	for i := 0; i < 2000; i++ {
+		mem, err := Create("ref_race_test", 64)
+		if err != nil {
+			t.Fatalf("Failed to create shm: %v", err)
+		}
+
+		ref := mem.SliceRef(0, 5)
+
+		done := make(chan struct{})
+		go func() {
+			ref.Release()
+			close(done)
+		}()
+		if err := mem.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		<-done
+
+		if mem.m != nil {
+			t.Fatalf("iteration %d: mapping leaked after Close raced with the last Release", i)
+		}
+	}
+}
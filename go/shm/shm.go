@@ -1,8 +1,22 @@
 package shm
 
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// closeRequested is the high bit of Memory.state: set once Close has
+// been called, leaving the low 31 bits free to count outstanding Refs.
+// Packing both into one word lets Close and release each update both
+// pieces of information with a single CAS, instead of a separate
+// load-then-store per field that a concurrent release could slip
+// between (see Close/release).
+const closeRequested = int32(-1) << 31
+
 // Memory is shared memory struct
 type Memory struct {
-	m *shmi
+	m     *shmi
+	state int32
 }
 
 // Create is create shared memory
@@ -11,7 +25,7 @@ func Create(name string, size int32) (*Memory, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Memory{m}, nil
+	return &Memory{m: m}, nil
 }
 
 // Open is open exist shared memory
@@ -20,22 +34,99 @@ func Open(name string, size int32) (*Memory, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Memory{m}, nil
+	return &Memory{m: m}, nil
 }
 
-// Close is close & discard shared memory
+// Close is close & discard shared memory. If a Ref returned by
+// SliceRef is still outstanding, the actual unmap is deferred until
+// the last such Ref is Released, so the mapping is never pulled out
+// from under a zero-copy slice still in use.
 func (o *Memory) Close() (err error) {
-	if o.m != nil {
-		err = o.m.close()
-		if err == nil {
-			o.m = nil
+	if o.m == nil {
+		return nil
+	}
+	for {
+		old := atomic.LoadInt32(&o.state)
+		if old&closeRequested != 0 {
+			return nil
+		}
+		if !atomic.CompareAndSwapInt32(&o.state, old, old|closeRequested) {
+			continue
+		}
+		if old&^closeRequested != 0 {
+			return nil
 		}
+		break
+	}
+	err = o.m.close()
+	if err == nil {
+		o.m = nil
 	}
 	return err
 }
 
-func (o *Memory) Slice(off int64, size int64) []byte {
-	return o.m.memRef(off, size)
+// Slice returns a zero-copy view of length bytes starting at off. The
+// returned slice is only valid until the Memory is closed; callers
+// that need it to outlive a possibly-concurrent Close should use
+// SliceRef instead.
+func (o *Memory) Slice(off int64, length int64) []byte {
+	return o.m.memRef(off, length)
+}
+
+// Ref pins the mapping behind a slice returned by Memory.SliceRef so
+// Close cannot unmap it out from under a reader. Modeled on the
+// manual-cache handles used by on-disk stores like Pebble's block
+// cache: a reference count kept alive by an explicit Release, with a
+// finalizer as a safety net for callers that forget to call it.
+type Ref struct {
+	mem *Memory
+	b   []byte
+}
+
+// Bytes returns the zero-copy slice this Ref pins.
+func (r *Ref) Bytes() []byte {
+	return r.b
+}
+
+// Release unpins the mapping. If Close was called while this was the
+// last outstanding Ref, Release performs the unmap Close deferred.
+func (r *Ref) Release() {
+	if r.mem == nil {
+		return
+	}
+	runtime.SetFinalizer(r, nil)
+	r.mem.release()
+	r.mem = nil
+}
+
+// SliceRef returns a zero-copy view of length bytes starting at off,
+// pinned against concurrent Close via the returned Ref. Call
+// Ref.Release once the slice is no longer needed.
+func (o *Memory) SliceRef(off int64, length int64) *Ref {
+	for {
+		old := atomic.LoadInt32(&o.state)
+		if atomic.CompareAndSwapInt32(&o.state, old, old+1) {
+			break
+		}
+	}
+	r := &Ref{mem: o, b: o.m.memRef(off, length)}
+	runtime.SetFinalizer(r, (*Ref).Release)
+	return r
+}
+
+func (o *Memory) release() {
+	for {
+		old := atomic.LoadInt32(&o.state)
+		newState := old - 1
+		if !atomic.CompareAndSwapInt32(&o.state, old, newState) {
+			continue
+		}
+		if newState == closeRequested {
+			o.m.close()
+			o.m = nil
+		}
+		return
+	}
 }
 
 // ReadAt is read shared memory (offset)
@@ -0,0 +1,187 @@
+// +build darwin freebsd
+// +build cgo
+
+package shm
+
+/*
+#cgo LDFLAGS: -lrt
+#cgo darwin LDFLAGS: -framework CoreFoundation
+
+#include <sys/mman.h>
+#include <sys/types.h>
+#include <sys/stat.h>
+#include <fcntl.h>
+#include <stdio.h>
+#include <unistd.h>
+
+int _create(const char* name, int size, int flag) {
+	mode_t mode = S_IRUSR | S_IWUSR | S_IRGRP | S_IWGRP;
+
+	int fd = shm_open(name, flag, mode);
+	if (fd < 0) {
+		return -1;
+	}
+
+	if (ftruncate(fd, size) != 0) {
+		close(fd);
+		return -2;
+	}
+	return fd;
+}
+
+int shm_create(const char* name, int size) {
+	int flag = O_RDWR | O_CREAT;
+	return _create(name, size, flag);
+}
+
+int _shm_open(const char* name, int size) {
+	int flag = O_RDWR;
+	return _create(name, size, flag);
+}
+
+void* shm_mmap(int fd, int size) {
+	void* p = mmap(
+		NULL, size,
+		PROT_READ | PROT_WRITE,
+		MAP_SHARED, fd, 0);
+	if (p == MAP_FAILED) {
+		return NULL;
+	}
+	return p;
+}
+
+void shm_close(int fd, void* p, int size) {
+	if (p != NULL) {
+		munmap(p, size);
+	}
+	if (fd != 0) {
+		close(fd);
+	}
+}
+
+void shm_delete(const char* name) {
+	shm_unlink(name);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// posixNameMax is the longest shm_open name used across darwin/freebsd:
+// 30 bytes including the leading slash, which stays within macOS's
+// PSHMNAMLEN of 31, the binding constraint. Longer names are truncated
+// to fit rather than failing at the syscall boundary.
+const posixNameMax = 30
+
+// pageSize is used to round the requested size up to a whole page,
+// since some BSD ftruncate implementations reject (or silently waste)
+// a shm object sized smaller than one page.
+func pageSize() int32 {
+	return int32(C.sysconf(C._SC_PAGESIZE))
+}
+
+func posixName(name string) string {
+	name = "/" + name
+	if len(name) > posixNameMax {
+		name = name[:posixNameMax]
+	}
+	return name
+}
+
+func alignToPage(size int32) int32 {
+	ps := pageSize()
+	if ps <= 0 {
+		return size
+	}
+	if rem := size % ps; rem != 0 {
+		size += ps - rem
+	}
+	return size
+}
+
+type shmi struct {
+	name   string
+	fd     C.int
+	v      unsafe.Pointer
+	size   int32
+	parent bool
+}
+
+// create shared memory. return shmi object.
+func create(name string, size int32) (*shmi, error) {
+	name = posixName(name)
+	mapSize := alignToPage(size)
+
+	fd := C.shm_create(C.CString(name), C.int(mapSize))
+	if fd < 0 {
+		return nil, fmt.Errorf("create:%v", fd)
+	}
+
+	v := C.shm_mmap(fd, C.int(mapSize))
+	if v == nil {
+		C.shm_close(fd, nil, C.int(mapSize))
+		C.shm_delete(C.CString(name))
+	}
+
+	return &shmi{name, fd, v, size, true}, nil
+}
+
+// open shared memory. return shmi object.
+func open(name string, size int32) (*shmi, error) {
+	name = posixName(name)
+	mapSize := alignToPage(size)
+
+	fd := C._shm_open(C.CString(name), C.int(mapSize))
+	if fd < 0 {
+		return nil, fmt.Errorf("open:%v", fd)
+	}
+
+	v := C.shm_mmap(fd, C.int(mapSize))
+	if v == nil {
+		C.shm_close(fd, nil, C.int(mapSize))
+		C.shm_delete(C.CString(name))
+	}
+
+	return &shmi{name, fd, v, size, false}, nil
+}
+
+func (o *shmi) close() error {
+	if o.v != nil {
+		C.shm_close(o.fd, o.v, C.int(alignToPage(o.size)))
+		o.v = nil
+	}
+	if o.parent {
+		C.shm_delete(C.CString(o.name))
+	}
+	return nil
+}
+
+// read shared memory. return read size.
+func (o *shmi) readAt(p []byte, off int64) int {
+	if max := int64(o.size) - off; int64(len(p)) > max {
+		p = p[:max]
+	}
+	copy(p, unsafe.Slice((*byte)(o.v), int(o.size))[off:])
+	return len(p)
+}
+
+// write shared memory. return write size.
+func (o *shmi) writeAt(p []byte, off int64) int {
+	if max := int64(o.size) - off; int64(len(p)) > max {
+		p = p[:max]
+	}
+	copy(unsafe.Slice((*byte)(o.v), int(o.size))[off:], p)
+	return len(p)
+}
+
+func (o *shmi) ptrAt(off int64) unsafe.Pointer {
+	return unsafe.Pointer(uintptr(o.v) + uintptr(off))
+}
+
+// memRef returns a zero-copy slice of length bytes starting at off.
+func (o *shmi) memRef(off int64, length int64) []byte {
+	return unsafe.Slice((*byte)(o.v), int(o.size))[off : off+length]
+}
@@ -0,0 +1,28 @@
+// +build darwin freebsd
+// +build cgo
+
+package shm
+
+import "testing"
+
+func TestBsdCreateThenOpen(t *testing.T) {
+	writer, err := Create("bsd_test", 64)
+	if err != nil {
+		t.Fatalf("Failed to create shm: %v", err)
+	}
+	defer writer.Close()
+
+	writer.WriteAt([]byte("hello"), 0)
+
+	reader, err := Open("bsd_test", 64)
+	if err != nil {
+		t.Fatalf("Failed to open shm from second handle: %v", err)
+	}
+	defer reader.Close()
+
+	bs := make([]byte, 5)
+	reader.ReadAt(bs, 0)
+	if string(bs) != "hello" {
+		t.Errorf("Expected second opener to see writer's data, got %q", bs)
+	}
+}
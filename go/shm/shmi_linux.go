@@ -85,7 +85,7 @@ func create(name string, size int32) (*shmi, error) {
 		return nil, fmt.Errorf("create:%v", fd)
 	}
 
-	v := C.shm_map(fd, C.int(size))
+	v := C.shm_mmap(fd, C.int(size))
 	if v == nil {
 		C.shm_close(fd, nil, C.int(size))
 		C.shm_delete(C.CString(name))
@@ -103,7 +103,7 @@ func open(name string, size int32) (*shmi, error) {
 		return nil, fmt.Errorf("open:%v", fd)
 	}
 
-	v := C.shm_map(fd, C.int(size))
+	v := C.shm_mmap(fd, C.int(size))
 	if v == nil {
 		C.shm_close(fd, nil, C.int(size))
 		C.shm_delete(C.CString(name))
@@ -128,7 +128,8 @@ func (o *shmi) readAt(p []byte, off int64) int {
 	if max := int64(o.size) - off; int64(len(p)) > max {
 		p = p[:max]
 	}
-	return copyPtr2Slice(uintptr(o.v), p, off, o.size)
+	copy(p, unsafe.Slice((*byte)(o.v), int(o.size))[off:])
+	return len(p)
 }
 
 // write shared memory. return write size.
@@ -136,15 +137,19 @@ func (o *shmi) writeAt(p []byte, off int64) int {
 	if max := int64(o.size) - off; int64(len(p)) > max {
 		p = p[:max]
 	}
-	return copySlice2Ptr(p, uintptr(o.v), off, o.size)
+	copy(unsafe.Slice((*byte)(o.v), int(o.size))[off:], p)
+	return len(p)
 }
 
-func (o *shmi) memRef(off int64, size int64) []byte {
-	h := reflect.SliceHeader{}
-	h.Cap = int(o.size)
-	h.Len = int(o.size)
-	h.Data = uintptr(o.v)
-	bb := *(*[]byte)(unsafe.Pointer(&h))
+// ptrAt returns a pointer to the byte at off within the mapping, for
+// callers (e.g. Header) that need to hand it to sync/atomic.
+func (o *shmi) ptrAt(off int64) unsafe.Pointer {
+	return unsafe.Pointer(uintptr(o.v) + uintptr(off))
+}
 
-	return bb[off:size]
+// memRef returns a zero-copy slice of length bytes starting at off,
+// backed directly by the mapping rather than a reflect.SliceHeader
+// hand-built over bytes it doesn't own.
+func (o *shmi) memRef(off int64, length int64) []byte {
+	return unsafe.Slice((*byte)(o.v), int(o.size))[off : off+length]
 }
@@ -0,0 +1,155 @@
+// +build windows
+
+package shm
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// golang.org/x/sys/windows wraps CreateFileMappingW but not
+// OpenFileMappingW, so open() calls the kernel32 export directly.
+var (
+	modkernel32          = windows.NewLazySystemDLL("kernel32.dll")
+	procOpenFileMappingW = modkernel32.NewProc("OpenFileMappingW")
+)
+
+func openFileMapping(access uint32, inheritHandle bool, name *uint16) (windows.Handle, error) {
+	var inherit uintptr
+	if inheritHandle {
+		inherit = 1
+	}
+	r0, _, e1 := procOpenFileMappingW.Call(uintptr(access), inherit, uintptr(unsafe.Pointer(name)))
+	if r0 == 0 {
+		if e1 != syscall.Errno(0) {
+			return 0, e1
+		}
+		return 0, syscall.EINVAL
+	}
+	return windows.Handle(r0), nil
+}
+
+// windowsName translates a POSIX-style "/name" into the Win32 kernel
+// object namespace. Names are session-local ("Local\") by default so
+// they don't collide with another user's session; callers that need a
+// machine-wide segment can still pass one already prefixed with
+// "Global\".
+func windowsName(name string) string {
+	if len(name) > 0 && name[0] == '/' {
+		name = name[1:]
+	}
+	if strHasPrefix(name, "Local\\") || strHasPrefix(name, "Global\\") {
+		return name
+	}
+	return "Local\\" + name
+}
+
+func strHasPrefix(s, prefix string) bool {
+	return len(s) >= len(prefix) && s[:len(prefix)] == prefix
+}
+
+type shmi struct {
+	name    string
+	mapping windows.Handle
+	v       unsafe.Pointer
+	size    int32
+	parent  bool
+}
+
+func mapView(mapping windows.Handle, size int32) (unsafe.Pointer, error) {
+	addr, err := windows.MapViewOfFile(mapping, windows.FILE_MAP_READ|windows.FILE_MAP_WRITE, 0, 0, uintptr(size))
+	if err != nil {
+		return nil, err
+	}
+	return unsafe.Pointer(addr), nil
+}
+
+// create shared memory. return shmi object.
+func create(name string, size int32) (*shmi, error) {
+	wname := windowsName(name)
+	namePtr, err := windows.UTF16PtrFromString(wname)
+	if err != nil {
+		return nil, fmt.Errorf("create:%v", err)
+	}
+
+	mapping, err := windows.CreateFileMapping(windows.InvalidHandle, nil, windows.PAGE_READWRITE, 0, uint32(size), namePtr)
+	if err != nil {
+		return nil, fmt.Errorf("create:%v", err)
+	}
+
+	v, err := mapView(mapping, size)
+	if err != nil {
+		windows.CloseHandle(mapping)
+		return nil, fmt.Errorf("create:%v", err)
+	}
+
+	return &shmi{wname, mapping, v, size, true}, nil
+}
+
+// open shared memory. return shmi object.
+func open(name string, size int32) (*shmi, error) {
+	wname := windowsName(name)
+	namePtr, err := windows.UTF16PtrFromString(wname)
+	if err != nil {
+		return nil, fmt.Errorf("open:%v", err)
+	}
+
+	mapping, err := openFileMapping(windows.FILE_MAP_READ|windows.FILE_MAP_WRITE, false, namePtr)
+	if err != nil {
+		return nil, fmt.Errorf("open:%v", err)
+	}
+
+	v, err := mapView(mapping, size)
+	if err != nil {
+		windows.CloseHandle(mapping)
+		return nil, fmt.Errorf("open:%v", err)
+	}
+
+	return &shmi{wname, mapping, v, size, false}, nil
+}
+
+func (o *shmi) close() error {
+	if o.v != nil {
+		windows.UnmapViewOfFile(uintptr(o.v))
+		o.v = nil
+	}
+	if o.mapping != 0 {
+		windows.CloseHandle(o.mapping)
+		o.mapping = 0
+	}
+	// there is no shm_unlink equivalent: a CreateFileMapping-backed
+	// section is destroyed automatically once its last handle closes,
+	// so parent just tracks who created it for API parity with the
+	// POSIX backends.
+	return nil
+}
+
+// read shared memory. return read size.
+func (o *shmi) readAt(p []byte, off int64) int {
+	if max := int64(o.size) - off; int64(len(p)) > max {
+		p = p[:max]
+	}
+	copy(p, unsafe.Slice((*byte)(o.v), int(o.size))[off:])
+	return len(p)
+}
+
+// write shared memory. return write size.
+func (o *shmi) writeAt(p []byte, off int64) int {
+	if max := int64(o.size) - off; int64(len(p)) > max {
+		p = p[:max]
+	}
+	copy(unsafe.Slice((*byte)(o.v), int(o.size))[off:], p)
+	return len(p)
+}
+
+func (o *shmi) ptrAt(off int64) unsafe.Pointer {
+	return unsafe.Pointer(uintptr(o.v) + uintptr(off))
+}
+
+// memRef returns a zero-copy slice of length bytes starting at off.
+func (o *shmi) memRef(off int64, length int64) []byte {
+	return unsafe.Slice((*byte)(o.v), int(o.size))[off : off+length]
+}